@@ -0,0 +1,77 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/oauth2/google"
+	dnsv1 "google.golang.org/api/dns/v1"
+)
+
+type cloudDNSProvider struct {
+	project string
+	service *dnsv1.Service
+}
+
+func newCloudDNSProvider(config Config) (Provider, error) {
+	if len(config.CloudDNSProject) == 0 {
+		return nil, fmt.Errorf("clouddns: project is required")
+	}
+
+	client, err := google.DefaultClient(context.Background(), dnsv1.NdevClouddnsReadwriteScope)
+	if err != nil {
+		return nil, fmt.Errorf("can't create Google Cloud DNS client: %w", err)
+	}
+
+	service, err := dnsv1.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("can't create Google Cloud DNS service: %w", err)
+	}
+
+	return &cloudDNSProvider{project: config.CloudDNSProject, service: service}, nil
+}
+
+func (p *cloudDNSProvider) Present(domain, fqdn, value string) error {
+	return p.changeRecord(fqdn, value, true)
+}
+
+func (p *cloudDNSProvider) CleanUp(domain, fqdn, value string) error {
+	return p.changeRecord(fqdn, value, false)
+}
+
+func (p *cloudDNSProvider) changeRecord(fqdn, value string, add bool) error {
+	zone, err := p.managedZone(fqdn)
+	if err != nil {
+		return err
+	}
+
+	rrset := &dnsv1.ResourceRecordSet{
+		Name:    fqdn,
+		Type:    "TXT",
+		Ttl:     60,
+		Rrdatas: []string{fmt.Sprintf("%q", value)},
+	}
+
+	change := &dnsv1.Change{}
+	if add {
+		change.Additions = []*dnsv1.ResourceRecordSet{rrset}
+	} else {
+		change.Deletions = []*dnsv1.ResourceRecordSet{rrset}
+	}
+
+	_, err = p.service.Changes.Create(p.project, zone, change).Do()
+	return err
+}
+
+func (p *cloudDNSProvider) managedZone(fqdn string) (string, error) {
+	zones, err := p.service.ManagedZones.List(p.project).DnsName(fqdn).Do()
+	if err != nil {
+		return "", fmt.Errorf("can't list managed zones for %q: %w", fqdn, err)
+	}
+
+	if len(zones.ManagedZones) == 0 {
+		return "", fmt.Errorf("no Cloud DNS managed zone found for %q", fqdn)
+	}
+
+	return zones.ManagedZones[0].Name, nil
+}
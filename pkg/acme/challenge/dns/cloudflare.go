@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+
+	cloudflare "github.com/cloudflare/cloudflare-go"
+)
+
+type cloudflareProvider struct {
+	api *cloudflare.API
+}
+
+func newCloudflareProvider(config Config) (Provider, error) {
+	if len(config.CloudflareAPIToken) == 0 {
+		return nil, fmt.Errorf("cloudflare: apiToken is required")
+	}
+
+	api, err := cloudflare.NewWithAPIToken(config.CloudflareAPIToken)
+	if err != nil {
+		return nil, fmt.Errorf("can't create Cloudflare client: %w", err)
+	}
+
+	return &cloudflareProvider{api: api}, nil
+}
+
+func (p *cloudflareProvider) Present(domain, fqdn, value string) error {
+	zoneID, err := p.zoneIDForDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.api.CreateDNSRecord(context.Background(), zoneID, cloudflare.DNSRecord{
+		Type:    "TXT",
+		Name:    fqdn,
+		Content: value,
+		TTL:     60,
+	})
+	return err
+}
+
+func (p *cloudflareProvider) CleanUp(domain, fqdn, value string) error {
+	zoneID, err := p.zoneIDForDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	records, err := p.api.DNSRecords(context.Background(), zoneID, cloudflare.DNSRecord{Type: "TXT", Name: fqdn, Content: value})
+	if err != nil {
+		return fmt.Errorf("can't list DNS records for %q: %w", fqdn, err)
+	}
+
+	for _, record := range records {
+		if err := p.api.DeleteDNSRecord(context.Background(), zoneID, record.ID); err != nil {
+			return fmt.Errorf("can't delete DNS record %q for %q: %w", record.ID, fqdn, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *cloudflareProvider) zoneIDForDomain(domain string) (string, error) {
+	zoneID, err := p.api.ZoneIDByName(domain)
+	if err != nil {
+		return "", fmt.Errorf("can't find Cloudflare zone for %q: %w", domain, err)
+	}
+	return zoneID, nil
+}
@@ -0,0 +1,62 @@
+// Package dns provides the pluggable DNS-01 challenge provider interface and the
+// built-in providers, constructed from a Config by NewProvider. The package reads no
+// flags and no CertIssuer configuration itself; the caller fills in the Config.
+package dns
+
+import "fmt"
+
+// Provider publishes and removes the TXT record required to satisfy an ACME DNS-01
+// challenge. domain is the hostname the certificate is being requested for, fqdn is the
+// fully qualified `_acme-challenge.<domain>.` record name (with the leading `*.` of a
+// wildcard domain removed), and value is the key
+// authorization digest that has to be published as the TXT record's value.
+type Provider interface {
+	Present(domain, fqdn, value string) error
+	CleanUp(domain, fqdn, value string) error
+}
+
+// Name identifies a built-in Provider implementation.
+type Name string
+
+const (
+	Route53    Name = "route53"
+	CloudDNS   Name = "clouddns"
+	Cloudflare Name = "cloudflare"
+	RFC2136    Name = "rfc2136"
+)
+
+// Config carries the provider-specific settings needed to construct a Provider. Only
+// the fields relevant to the selected Name have to be set.
+type Config struct {
+	Name Name
+
+	// Route53
+	Route53Region string
+
+	// CloudDNS
+	CloudDNSProject string
+
+	// Cloudflare
+	CloudflareAPIToken string
+
+	// RFC2136
+	RFC2136Nameserver string
+	RFC2136TSIGKey    string
+	RFC2136TSIGSecret string
+}
+
+// NewProvider constructs the built-in Provider selected by config.Name.
+func NewProvider(config Config) (Provider, error) {
+	switch config.Name {
+	case Route53:
+		return newRoute53Provider(config)
+	case CloudDNS:
+		return newCloudDNSProvider(config)
+	case Cloudflare:
+		return newCloudflareProvider(config)
+	case RFC2136:
+		return newRFC2136Provider(config)
+	default:
+		return nil, fmt.Errorf("unknown DNS-01 provider %q", config.Name)
+	}
+}
@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// rfc2136Provider implements DNS-01 against an authoritative nameserver that accepts
+// RFC 2136 dynamic updates. Updates are signed with a TSIG key when a key name is
+// configured and sent unsigned otherwise.
+type rfc2136Provider struct {
+	nameserver string
+	tsigKey    string
+	tsigSecret string
+}
+
+func newRFC2136Provider(config Config) (Provider, error) {
+	if len(config.RFC2136Nameserver) == 0 {
+		return nil, fmt.Errorf("rfc2136: nameserver is required")
+	}
+
+	return &rfc2136Provider{
+		nameserver: config.RFC2136Nameserver,
+		tsigKey:    config.RFC2136TSIGKey,
+		tsigSecret: config.RFC2136TSIGSecret,
+	}, nil
+}
+
+func (p *rfc2136Provider) Present(domain, fqdn, value string) error {
+	return p.update(fqdn, value, dns.TypeTXT, false)
+}
+
+func (p *rfc2136Provider) CleanUp(domain, fqdn, value string) error {
+	return p.update(fqdn, value, dns.TypeTXT, true)
+}
+
+func (p *rfc2136Provider) update(fqdn, value string, rrType uint16, remove bool) error {
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(fqdn))
+
+	rr, err := dns.NewRR(fmt.Sprintf("%s 60 IN TXT %q", dns.Fqdn(fqdn), value))
+	if err != nil {
+		return fmt.Errorf("can't build TXT record for %q: %w", fqdn, err)
+	}
+
+	if remove {
+		m.Remove([]dns.RR{rr})
+	} else {
+		m.Insert([]dns.RR{rr})
+	}
+
+	client := new(dns.Client)
+	if len(p.tsigKey) != 0 {
+		m.SetTsig(p.tsigKey, dns.HmacSHA256, 300, time.Now().Unix())
+		client.TsigSecret = map[string]string{p.tsigKey: p.tsigSecret}
+	}
+
+	_, _, err = client.Exchange(m, p.nameserver)
+	if err != nil {
+		return fmt.Errorf("RFC2136 update against %q failed: %w", p.nameserver, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package dns
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+)
+
+type route53Provider struct {
+	client *route53.Route53
+}
+
+func newRoute53Provider(config Config) (Provider, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(config.Route53Region),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't create AWS session: %w", err)
+	}
+
+	return &route53Provider{client: route53.New(sess)}, nil
+}
+
+func (p *route53Provider) Present(domain, fqdn, value string) error {
+	return p.changeRecord(fqdn, value, route53.ChangeActionUpsert)
+}
+
+func (p *route53Provider) CleanUp(domain, fqdn, value string) error {
+	return p.changeRecord(fqdn, value, route53.ChangeActionDelete)
+}
+
+func (p *route53Provider) changeRecord(fqdn, value, action string) error {
+	zoneID, err := p.hostedZoneID(fqdn)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.client.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{
+				{
+					Action: aws.String(action),
+					ResourceRecordSet: &route53.ResourceRecordSet{
+						Name:            aws.String(fqdn),
+						Type:            aws.String("TXT"),
+						TTL:             aws.Int64(60),
+						ResourceRecords: []*route53.ResourceRecord{{Value: aws.String(fmt.Sprintf("%q", value))}},
+					},
+				},
+			},
+		},
+	})
+	return err
+}
+
+func (p *route53Provider) hostedZoneID(fqdn string) (string, error) {
+	out, err := p.client.ListHostedZonesByName(&route53.ListHostedZonesByNameInput{
+		DNSName: aws.String(fqdn),
+	})
+	if err != nil {
+		return "", fmt.Errorf("can't list hosted zones for %q: %w", fqdn, err)
+	}
+
+	if len(out.HostedZones) == 0 {
+		return "", fmt.Errorf("no Route53 hosted zone found for %q", fqdn)
+	}
+
+	return aws.StringValue(out.HostedZones[0].Id), nil
+}
@@ -0,0 +1,195 @@
+// Package builder lazily registers the single ACME account shared by the whole
+// operator and hands out the resulting Client to every controller that needs to talk
+// to the CA.
+package builder
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/acme"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+
+	acmeclient "github.com/tnozicka/openshift-acme/pkg/acme/client"
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/metrics"
+)
+
+// ExternalAccountBinding carries the credentials a CA issued out-of-band (e.g. via its
+// web UI) that are required to register an account when the directory advertises
+// `externalAccountRequired`.
+type ExternalAccountBinding struct {
+	KeyID string
+	// Key is the base64url-encoded (no padding) HMAC key, as handed out by the CA.
+	Key string
+}
+
+// NewSharedClientFactory resolves the operator's external account binding Secret (if
+// any was configured) and returns a SharedClientFactory ready to register the shared
+// operator account on first use.
+func NewSharedClientFactory(
+	kubeClient kubernetes.Interface,
+	namespace string,
+	directoryURL string,
+	privateKey crypto.Signer,
+	eab *api.ExternalAccountBinding,
+	recorder record.EventRecorder,
+) (*SharedClientFactory, error) {
+	factory := &SharedClientFactory{
+		DirectoryURL: directoryURL,
+		PrivateKey:   privateKey,
+		Recorder:     recorder,
+	}
+
+	if eab == nil {
+		return factory, nil
+	}
+
+	resolved, err := resolveExternalAccountBinding(kubeClient, namespace, eab)
+	if err != nil {
+		return nil, err
+	}
+	factory.ExternalAccountBinding = resolved
+
+	return factory, nil
+}
+
+func resolveExternalAccountBinding(kubeClient kubernetes.Interface, namespace string, eab *api.ExternalAccountBinding) (*ExternalAccountBinding, error) {
+	if len(eab.KeyID) == 0 {
+		return nil, fmt.Errorf("externalAccountBinding.keyID can't be empty")
+	}
+
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(eab.KeySecretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("externalAccountBinding references Secret %s/%s which doesn't exist", namespace, eab.KeySecretName)
+		}
+		return nil, err
+	}
+
+	key, ok := secret.Data[api.ExternalAccountBindingKeyDataKey]
+	if !ok || len(key) == 0 {
+		return nil, fmt.Errorf("secret %s/%s is missing key %q", namespace, eab.KeySecretName, api.ExternalAccountBindingKeyDataKey)
+	}
+
+	if err := validateHMACKey(string(key)); err != nil {
+		return nil, fmt.Errorf("secret %s/%s key %q is invalid: %w", namespace, eab.KeySecretName, api.ExternalAccountBindingKeyDataKey, err)
+	}
+
+	return &ExternalAccountBinding{
+		KeyID: eab.KeyID,
+		Key:   string(key),
+	}, nil
+}
+
+// validateHMACKey checks that key base64url-decodes to a non-empty HMAC key usable for
+// HS256 signing, the way the CA will use it to verify the EAB JWS.
+func validateHMACKey(key string) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("can't base64url-decode HMAC key: %w", err)
+	}
+
+	if len(decoded) == 0 {
+		return fmt.Errorf("HMAC key is empty")
+	}
+
+	mac := hmac.New(sha256.New, decoded)
+	_, err = mac.Write([]byte("openshift-acme/eab-validation"))
+	if err != nil {
+		return fmt.Errorf("can't sign with HMAC key: %w", err)
+	}
+
+	return nil
+}
+
+// SharedClientFactory registers (once) and caches the single ACME account the operator
+// uses for every Route it manages.
+type SharedClientFactory struct {
+	DirectoryURL           string
+	PrivateKey             crypto.Signer
+	ExternalAccountBinding *ExternalAccountBinding
+	Recorder               record.EventRecorder
+
+	once   sync.Once
+	client *acmeclient.Client
+	err    error
+}
+
+func (f *SharedClientFactory) GetClient(ctx context.Context) (*acmeclient.Client, error) {
+	f.once.Do(func() {
+		f.client, f.err = f.register(ctx)
+	})
+
+	return f.client, f.err
+}
+
+func (f *SharedClientFactory) register(ctx context.Context) (*acmeclient.Client, error) {
+	rawClient := &acme.Client{
+		DirectoryURL: f.DirectoryURL,
+		Key:          f.PrivateKey,
+		UserAgent:    "github.com/tnozicka/openshift-acme",
+		HTTPClient: &http.Client{
+			Transport: &metrics.InstrumentedRoundTripper{Directory: f.DirectoryURL},
+		},
+	}
+
+	dir, err := rawClient.Discover(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't discover ACME directory %q: %w", f.DirectoryURL, err)
+	}
+
+	account := &acme.Account{}
+
+	if dir.ExternalAccountRequired {
+		if f.ExternalAccountBinding == nil {
+			f.event("AccountRegistrationFailed", "Directory %q requires external account binding but none was configured", f.DirectoryURL)
+			return nil, fmt.Errorf("directory %q requires external account binding but none was configured", f.DirectoryURL)
+		}
+	}
+
+	if f.ExternalAccountBinding != nil {
+		key, err := base64.RawURLEncoding.DecodeString(f.ExternalAccountBinding.Key)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode external account binding key: %w", err)
+		}
+
+		account.ExternalAccountBinding = &acme.ExternalAccountBinding{
+			KID: f.ExternalAccountBinding.KeyID,
+			Key: key,
+		}
+	}
+
+	account, err = rawClient.Register(ctx, account, func(tosURL string) bool {
+		klog.Infof("By continuing running this program you agree to the CA's Terms of Service (%s). If you do not agree exit the program immediately!", tosURL)
+		return true
+	})
+	if err != nil {
+		f.event("AccountRegistrationFailed", "Failed to register operator account with directory %q: %v", f.DirectoryURL, err)
+		return nil, fmt.Errorf("can't register account with directory %q: %w", f.DirectoryURL, err)
+	}
+
+	f.event("AccountRegistered", "Registered operator account %q with directory %q", account.URI, f.DirectoryURL)
+
+	return &acmeclient.Client{Client: rawClient}, nil
+}
+
+func (f *SharedClientFactory) event(reason, messageFmt string, args ...interface{}) {
+	if f.Recorder == nil {
+		return
+	}
+
+	// The operator account isn't tied to a single Kubernetes object, so the event is
+	// logged rather than attached to one.
+	klog.Warningf(reason+": "+messageFmt, args...)
+}
@@ -0,0 +1,32 @@
+// Package client wraps golang.org/x/crypto/acme.Client with the extra state the
+// controllers need around a single ACME account.
+package client
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Client is the shared ACME client handed out to controllers once the operator's
+// account has been registered.
+type Client struct {
+	Client *acme.Client
+}
+
+// GetAuthorizationErrors renders the per-challenge errors of a failed Authorization
+// into a single human readable string, suitable for an Event message.
+func GetAuthorizationErrors(authz *acme.Authorization) string {
+	if authz == nil {
+		return ""
+	}
+
+	var msgs []string
+	for _, c := range authz.Challenges {
+		if c.Error != nil {
+			msgs = append(msgs, c.Error.Error())
+		}
+	}
+
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,73 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+)
+
+// PrivateKeyAlgorithm selects the key type used for a certificate's private key.
+type PrivateKeyAlgorithm string
+
+const (
+	PrivateKeyAlgorithmRSA   PrivateKeyAlgorithm = "RSA"
+	PrivateKeyAlgorithmECDSA PrivateKeyAlgorithm = "ECDSA"
+)
+
+// GeneratePrivateKey generates a crypto.Signer of the requested algorithm. size is
+// interpreted as RSA modulus bits (e.g. 2048, 3072, 4096) for PrivateKeyAlgorithmRSA, or
+// as the ECDSA curve name ("P256", "P384") for PrivateKeyAlgorithmECDSA.
+func GeneratePrivateKey(algorithm PrivateKeyAlgorithm, size string) (crypto.Signer, error) {
+	switch algorithm {
+	case "", PrivateKeyAlgorithmRSA:
+		bits, err := rsaKeySize(size)
+		if err != nil {
+			return nil, err
+		}
+		return rsa.GenerateKey(cryptorand.Reader, bits)
+
+	case PrivateKeyAlgorithmECDSA:
+		curve, err := ecdsaCurve(size)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.GenerateKey(curve, cryptorand.Reader)
+
+	default:
+		return nil, fmt.Errorf("unsupported private key algorithm %q", algorithm)
+	}
+}
+
+func rsaKeySize(size string) (int, error) {
+	switch size {
+	case "", "4096":
+		return 4096, nil
+	case "2048":
+		return 2048, nil
+	case "3072":
+		return 3072, nil
+	default:
+		return 0, fmt.Errorf("unsupported RSA key size %q, expected one of 2048, 3072, 4096", size)
+	}
+}
+
+func ecdsaCurve(size string) (elliptic.Curve, error) {
+	switch size {
+	case "", "P256":
+		return elliptic.P256(), nil
+	case "P384":
+		return elliptic.P384(), nil
+	default:
+		return nil, fmt.Errorf("unsupported ECDSA curve %q, expected one of P256, P384", size)
+	}
+}
+
+// MarshalPrivateKeyDER DER-encodes key as a PKCS#8 private key, uniformly for every
+// algorithm GeneratePrivateKey can produce.
+func MarshalPrivateKeyDER(key crypto.Signer) ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(key)
+}
@@ -0,0 +1,65 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/x509"
+	"reflect"
+	"testing"
+)
+
+func TestGeneratePrivateKeyRoundTripsThroughMarshalPrivateKeyDER(t *testing.T) {
+	tt := []struct {
+		name      string
+		algorithm PrivateKeyAlgorithm
+		size      string
+	}{
+		{name: "default algorithm and size"},
+		{name: "RSA 2048", algorithm: PrivateKeyAlgorithmRSA, size: "2048"},
+		{name: "RSA 3072", algorithm: PrivateKeyAlgorithmRSA, size: "3072"},
+		{name: "RSA 4096", algorithm: PrivateKeyAlgorithmRSA, size: "4096"},
+		{name: "ECDSA P256", algorithm: PrivateKeyAlgorithmECDSA, size: "P256"},
+		{name: "ECDSA P384", algorithm: PrivateKeyAlgorithmECDSA, size: "P384"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := GeneratePrivateKey(tc.algorithm, tc.size)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			der, err := MarshalPrivateKeyDER(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			parsed, err := x509.ParsePKCS8PrivateKey(der)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			signer, ok := parsed.(crypto.Signer)
+			if !ok {
+				t.Fatalf("parsed key of type %T doesn't implement crypto.Signer", parsed)
+			}
+
+			if !reflect.DeepEqual(key.Public(), signer.Public()) {
+				t.Errorf("public key didn't round-trip through MarshalPrivateKeyDER")
+			}
+		})
+	}
+}
+
+func TestGeneratePrivateKeyRejectsUnsupportedAlgorithmAndSize(t *testing.T) {
+	if _, err := GeneratePrivateKey("not-a-real-algorithm", ""); err == nil {
+		t.Errorf("expected an error for an unsupported algorithm, got nil")
+	}
+
+	if _, err := GeneratePrivateKey(PrivateKeyAlgorithmRSA, "1024"); err == nil {
+		t.Errorf("expected an error for an unsupported RSA key size, got nil")
+	}
+
+	if _, err := GeneratePrivateKey(PrivateKeyAlgorithmECDSA, "P521"); err == nil {
+		t.Errorf("expected an error for an unsupported ECDSA curve, got nil")
+	}
+}
@@ -2,10 +2,11 @@ package acme
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
+	"crypto"
 	"crypto/sha512"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"reflect"
@@ -37,6 +38,10 @@ import (
 
 const (
 	ControllerName = "openshift-acme-acme-account-controller"
+
+	// AccountPreviousPrivateKeyDataKey holds the account key that was rotated out, kept
+	// for a single reconcile cycle so a failed rollover can be rolled back manually.
+	AccountPreviousPrivateKeyDataKey = "tls.key.previous"
 )
 
 var (
@@ -101,14 +106,14 @@ func NewAccountController(
 	return ac
 }
 
-func (ac *AccountController) Run(workers int, stopCh <-chan struct{}) {
+func (ac *AccountController) Run(ctx context.Context, workers int) {
 	defer utilruntime.HandleCrash()
 	defer ac.queue.ShutDown()
 
 	klog.Info("Starting Account controller")
 	defer klog.Info("Shutting down Account controller")
 
-	if !cache.WaitForCacheSync(stopCh, ac.cachesToSync...) {
+	if !cache.WaitForCacheSync(ctx.Done(), ac.cachesToSync...) {
 		utilruntime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
 		return
 	}
@@ -116,25 +121,25 @@ func (ac *AccountController) Run(workers int, stopCh <-chan struct{}) {
 	klog.Info("Account controller informer caches synced")
 
 	for i := 0; i < workers; i++ {
-		go wait.Until(ac.runWorker, time.Second, stopCh)
+		go wait.UntilWithContext(ctx, ac.runWorker, time.Second)
 	}
 
-	<-stopCh
+	<-ctx.Done()
 }
 
-func (ac *AccountController) runWorker() {
-	for ac.processNextItem() {
+func (ac *AccountController) runWorker(ctx context.Context) {
+	for ac.processNextItem(ctx) {
 	}
 }
 
-func (ac *AccountController) processNextItem() bool {
+func (ac *AccountController) processNextItem(ctx context.Context) bool {
 	key, quit := ac.queue.Get()
 	if quit {
 		return false
 	}
 	defer ac.queue.Done(key)
 
-	err := ac.sync(key.(string))
+	err := ac.sync(ctx, key.(string))
 
 	if err == nil {
 		ac.queue.Forget(key)
@@ -255,7 +260,7 @@ func (ac *AccountController) deleteSecret(obj interface{}) {
 	}
 }
 
-func (ac *AccountController) sync(key string) error {
+func (ac *AccountController) sync(ctx context.Context, key string) error {
 	klog.V(4).Infof("Started syncing Account %q", key)
 	defer func() {
 		klog.V(4).Infof("Finished syncing Account %q", key)
@@ -280,11 +285,6 @@ func (ac *AccountController) sync(key string) error {
 
 	cmReadOnly := objReadOnly.(*corev1.ConfigMap)
 
-	// Don't act on objects that are being deleted.
-	if cmReadOnly.DeletionTimestamp != nil {
-		return nil
-	}
-
 	certIssuerData, ok := cmReadOnly.Data[api.CertIssuerDataKey]
 	if !ok {
 		return fmt.Errorf("configmap %s is matching CertIssuer selectors %q but missing key %q", key, api.AccountLabelSet, api.CertIssuerDataKey)
@@ -307,6 +307,23 @@ func (ac *AccountController) sync(key string) error {
 
 	acmeIssuer := certIssuer.AcmeCertIssuer
 
+	if len(acmeIssuer.AccountCredentialsSecretName) == 0 {
+		acmeIssuer.AccountCredentialsSecretName = cmReadOnly.Name
+	}
+
+	if cmReadOnly.DeletionTimestamp != nil {
+		return ac.finalizeAccount(ctx, cmReadOnly, acmeIssuer)
+	}
+
+	if !hasAccountFinalizer(cmReadOnly) {
+		cm := cmReadOnly.DeepCopy()
+		cm.Finalizers = append(cm.Finalizers, api.AccountFinalizer)
+		cmReadOnly, err = ac.kubeClient.CoreV1().ConfigMaps(cmReadOnly.Namespace).Update(cm)
+		if err != nil {
+			return fmt.Errorf("can't add finalizer %q: %w", api.AccountFinalizer, err)
+		}
+	}
+
 	client := &acme.Client{
 		DirectoryURL: acmeIssuer.DirectoryUrl,
 		UserAgent:    "github.com/tnozicka/openshift-acme",
@@ -315,36 +332,59 @@ func (ac *AccountController) sync(key string) error {
 		Contact: acmeIssuer.Account.Contacts,
 	}
 
-	if len(acmeIssuer.AccountCredentialsSecretName) == 0 {
-		acmeIssuer.AccountCredentialsSecretName = cmReadOnly.Name
+	if acmeIssuer.ExternalAccountBinding != nil {
+		eab, err := ac.externalAccountBinding(cmReadOnly.Namespace, acmeIssuer.ExternalAccountBinding)
+		if err != nil {
+			ac.recorder.Eventf(cmReadOnly, corev1.EventTypeWarning, "AccountRegistrationFailed", "Can't build external account binding: %v", err)
+			return fmt.Errorf("configmap %s: can't build external account binding: %w", key, err)
+		}
+
+		account.ExternalAccountBinding = eab
 	}
 
 	secret, err := ac.kubeInformersForNamespaces.InformersForOrGlobal(cmReadOnly.Namespace).Core().V1().Secrets().Lister().Secrets(cmReadOnly.Namespace).Get(acmeIssuer.AccountCredentialsSecretName)
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	} else if apierrors.IsNotFound(err) {
+		if len(acmeIssuer.Account.Status.URI) != 0 {
+			ac.recorder.Eventf(cmReadOnly, corev1.EventTypeWarning, "AccountKeyMissing", "Account credentials Secret %q is missing but CertIssuer already has a registered account %q; refusing to register a new one automatically to avoid hitting the CA's new-account rate limit. Restore the Secret or clear %q to opt into a fresh registration.", acmeIssuer.AccountCredentialsSecretName, acmeIssuer.Account.Status.URI, api.CertIssuerDataKey)
+			return fmt.Errorf("configmap %s: account credentials Secret %q is missing but account %q is already registered", key, acmeIssuer.AccountCredentialsSecretName, acmeIssuer.Account.Status.URI)
+		}
+
+		ac.recorder.Eventf(cmReadOnly, corev1.EventTypeWarning, "AccountKeyMissing", "Account credentials Secret %q not found, registering a new account with directory %q", acmeIssuer.AccountCredentialsSecretName, acmeIssuer.DirectoryUrl)
+
 		// Register new account
-		privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
+		privateKey, keyBlock, err := helpers.GeneratePrivateKey(acmeIssuer.PrivateKeyAlgorithm)
 		if err != nil {
 			return err
 		}
 		client.Key = privateKey
 
-		keyPem := pem.EncodeToMemory(&pem.Block{
-			Type:  "RSA PRIVATE KEY",
-			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-		})
+		keyPem := pem.EncodeToMemory(keyBlock)
+		ac.recorder.Eventf(cmReadOnly, corev1.EventTypeNormal, "AccountKeyGenerated", "Generated a new %s account key", acmeIssuer.PrivateKeyAlgorithm)
 
-		registerCtx, registerCtxCancel := context.WithTimeout(context.TODO(), 15*time.Second)
+		registerCtx, registerCtxCancel := context.WithTimeout(ctx, 15*time.Second)
 		defer registerCtxCancel()
 		account, err = client.Register(registerCtx, account, acceptTerms)
 		if err != nil {
+			ac.recorder.Eventf(cmReadOnly, corev1.EventTypeWarning, "AccountRegistrationFailed", "Failed to register account with directory %q: %v", acmeIssuer.DirectoryUrl, err)
 			return err
 		}
+		ac.recorder.Eventf(cmReadOnly, corev1.EventTypeNormal, "ToSAccepted", "Accepted CA's Terms of Service")
 
+		trueVal := true
 		secret := &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
 				Name: acmeIssuer.AccountCredentialsSecretName,
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion:         corev1.SchemeGroupVersion.String(),
+						Kind:               "ConfigMap",
+						Name:               cmReadOnly.Name,
+						UID:                cmReadOnly.UID,
+						BlockOwnerDeletion: &trueVal,
+					},
+				},
 			},
 			Type: corev1.SecretTypeOpaque,
 			Data: map[string][]byte{
@@ -355,34 +395,76 @@ func (ac *AccountController) sync(key string) error {
 		if err != nil {
 			return err
 		}
+
+		ac.recorder.Eventf(cmReadOnly, corev1.EventTypeNormal, "AccountRegistered", "Registered account %q with directory %q", account.URI, acmeIssuer.DirectoryUrl)
 	} else {
 		client.Key, err = helpers.PrivateKeyFromSecret(secret)
 		if err != nil {
 			return err
 		}
 
+		justRotated := false
+		if cmReadOnly.Annotations[api.RotateAccountKeyAnnotation] == "true" {
+			secret, err = ac.rotateAccountKey(ctx, client, secret, acmeIssuer.PrivateKeyAlgorithm)
+			if err != nil {
+				ac.recorder.Eventf(cmReadOnly, corev1.EventTypeWarning, "AccountRegistrationFailed", "Failed to rotate account key: %v", err)
+				return err
+			}
+			justRotated = true
+
+			cm := cmReadOnly.DeepCopy()
+			delete(cm.Annotations, api.RotateAccountKeyAnnotation)
+			cmReadOnly, err = ac.kubeClient.CoreV1().ConfigMaps(cmReadOnly.Namespace).Update(cm)
+			if err != nil {
+				return fmt.Errorf("can't clear %q annotation: %w", api.RotateAccountKeyAnnotation, err)
+			}
+
+			ac.recorder.Eventf(cmReadOnly, corev1.EventTypeNormal, "AccountKeyGenerated", "Rotated account key for account %q", acmeIssuer.Account.Status.URI)
+		}
+
+		// The reconcile right after a rotation keeps AccountPreviousPrivateKeyDataKey
+		// around so a failed rollover can still be rolled back manually; the next
+		// reconcile to see it strips it, so it doesn't linger in the Secret forever.
+		if !justRotated {
+			if _, ok := secret.Data[AccountPreviousPrivateKeyDataKey]; ok {
+				newSecret := secret.DeepCopy()
+				delete(newSecret.Data, AccountPreviousPrivateKeyDataKey)
+				secret, err = ac.kubeClient.CoreV1().Secrets(secret.Namespace).Update(newSecret)
+				if err != nil {
+					return fmt.Errorf("can't clear previous account key %q: %w", AccountPreviousPrivateKeyDataKey, err)
+				}
+				ac.recorder.Eventf(cmReadOnly, corev1.EventTypeNormal, "AccountPreviousKeyCleared", "Removed previous account key after rollback grace period")
+			}
+		}
+
 		// Todo sign statuses with client.Key.Sign so the can't be modified externally
 
-		accountHash := hashAccount(acmeIssuer.Account)
+		acmeIssuer.Account.Status.KeyFingerprint = fingerprintKey(client.Key)
+
+		accountHash := hashAccount(acmeIssuer.Account, account.ExternalAccountBinding)
 
 		if reflect.DeepEqual(accountHash, []byte(acmeIssuer.Account.Status.Hash)) {
 			// Update the acme account to reflect user changes
 			account.Contact = acmeIssuer.Account.Contacts
 
-			updateCtx, updateCtxCancel := context.WithTimeout(context.TODO(), 15*time.Second)
+			updateCtx, updateCtxCancel := context.WithTimeout(ctx, 15*time.Second)
 			defer updateCtxCancel()
 			account, err = client.UpdateReg(updateCtx, account)
 			if err != nil {
+				ac.recorder.Eventf(cmReadOnly, corev1.EventTypeWarning, "AccountRegistrationFailed", "Failed to update account %q: %v", acmeIssuer.Account.Status.URI, err)
 				return err
 			}
+			ac.recorder.Eventf(cmReadOnly, corev1.EventTypeNormal, "AccountUpdated", "Updated account %q contacts", account.URI)
 		} else if len(acmeIssuer.Account.Status.URI) == 0 {
-			getRegCtx, getRegCtxCancel := context.WithTimeout(context.TODO(), 15*time.Second)
+			getRegCtx, getRegCtxCancel := context.WithTimeout(ctx, 15*time.Second)
 			defer getRegCtxCancel()
 			// url argument is not needed for RFC 8555 compliant CAs
 			account, err = client.GetReg(getRegCtx, "")
 			if err != nil {
+				ac.recorder.Eventf(cmReadOnly, corev1.EventTypeWarning, "AccountRegistrationFailed", "Failed to retrieve account from directory %q: %v", acmeIssuer.DirectoryUrl, err)
 				return err
 			}
+			ac.recorder.Eventf(cmReadOnly, corev1.EventTypeNormal, "AccountRegistered", "Retrieved existing account %q from directory %q", account.URI, acmeIssuer.DirectoryUrl)
 		}
 	}
 
@@ -390,7 +472,7 @@ func (ac *AccountController) sync(key string) error {
 	acmeIssuer.Account.Contacts = account.Contact
 	acmeIssuer.Account.Status.OrdersURL = account.OrdersURL
 	acmeIssuer.Account.Status.AccountStatus = account.Status
-	acmeIssuer.Account.Status.Hash = fmt.Sprint(hashAccount(acmeIssuer.Account))
+	acmeIssuer.Account.Status.Hash = fmt.Sprint(hashAccount(acmeIssuer.Account, account.ExternalAccountBinding))
 
 	cm := cmReadOnly.DeepCopy()
 	certIssuerBytes, err := yaml.Marshal(certIssuer)
@@ -412,6 +494,155 @@ func (ac *AccountController) sync(key string) error {
 	return nil
 }
 
-func hashAccount(account api.AcmeAccount) [64]byte {
-	return sha512.Sum512([]byte(fmt.Sprint(account.Contacts)))
+func hasAccountFinalizer(cm *corev1.ConfigMap) bool {
+	for _, f := range cm.Finalizers {
+		if f == api.AccountFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// finalizeAccount deactivates the ACME account at the CA before letting the ConfigMap
+// go away, so the account Secret isn't stranded and re-registering under the same
+// CertIssuer name later doesn't reuse a deactivated account's state.
+func (ac *AccountController) finalizeAccount(ctx context.Context, cm *corev1.ConfigMap, acmeIssuer api.AcmeCertIssuer) error {
+	if !hasAccountFinalizer(cm) {
+		return nil
+	}
+
+	if len(acmeIssuer.Account.Status.URI) != 0 {
+		secret, err := ac.kubeInformersForNamespaces.InformersForOrGlobal(cm.Namespace).Core().V1().Secrets().Lister().Secrets(cm.Namespace).Get(acmeIssuer.AccountCredentialsSecretName)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		if err == nil {
+			key, err := helpers.PrivateKeyFromSecret(secret)
+			if err != nil {
+				return fmt.Errorf("can't deactivate account %q: %w", acmeIssuer.Account.Status.URI, err)
+			}
+
+			client := &acme.Client{
+				DirectoryURL: acmeIssuer.DirectoryUrl,
+				UserAgent:    "github.com/tnozicka/openshift-acme",
+				Key:          key,
+			}
+
+			deactivateCtx, deactivateCtxCancel := context.WithTimeout(ctx, 15*time.Second)
+			defer deactivateCtxCancel()
+			_, err = client.DeactivateReg(deactivateCtx)
+			if err != nil {
+				ac.recorder.Eventf(cm, corev1.EventTypeWarning, "AccountRegistrationFailed", "Failed to deactivate account %q: %v", acmeIssuer.Account.Status.URI, err)
+				return fmt.Errorf("can't deactivate account %q: %w", acmeIssuer.Account.Status.URI, err)
+			}
+		}
+	}
+
+	newCm := cm.DeepCopy()
+	newCm.Finalizers = nil
+	for _, f := range cm.Finalizers {
+		if f != api.AccountFinalizer {
+			newCm.Finalizers = append(newCm.Finalizers, f)
+		}
+	}
+
+	_, err := ac.kubeClient.CoreV1().ConfigMaps(cm.Namespace).Update(newCm)
+	if err != nil {
+		return fmt.Errorf("can't remove finalizer %q: %w", api.AccountFinalizer, err)
+	}
+
+	return nil
+}
+
+// externalAccountBinding resolves the EAB key id and HMAC key material referenced by
+// a CertIssuer from the Secret it points at and builds the acme.ExternalAccountBinding
+// that has to be submitted together with the account registration.
+func (ac *AccountController) externalAccountBinding(namespace string, eab *api.ExternalAccountBinding) (*acme.ExternalAccountBinding, error) {
+	if len(eab.KeyID) == 0 {
+		return nil, fmt.Errorf("externalAccountBinding.keyID can't be empty")
+	}
+
+	secretName := eab.KeySecretName
+	secret, err := ac.kubeInformersForNamespaces.InformersForOrGlobal(namespace).Core().V1().Secrets().Lister().Secrets(namespace).Get(secretName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("externalAccountBinding references Secret %s/%s which doesn't exist", namespace, secretName)
+		}
+		return nil, err
+	}
+
+	encodedKey, ok := secret.Data[api.ExternalAccountBindingKeyDataKey]
+	if !ok || len(encodedKey) == 0 {
+		return nil, fmt.Errorf("secret %s/%s is missing key %q", namespace, secretName, api.ExternalAccountBindingKeyDataKey)
+	}
+
+	// CAs hand out the HMAC key base64url-encoded (no padding); decode it the same way
+	// the shared ACME client builder does for the operator account's own EAB.
+	key, err := base64.RawURLEncoding.DecodeString(string(encodedKey))
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s key %q is not valid base64url: %w", namespace, secretName, api.ExternalAccountBindingKeyDataKey, err)
+	}
+
+	return &acme.ExternalAccountBinding{
+		KID: eab.KeyID,
+		Key: key,
+	}, nil
+}
+
+// hashAccount hashes the resolved EAB key material (not the CertIssuer's Secret
+// reference) alongside the rest of the account's user-controlled fields, so rotating the
+// HMAC key bytes inside an unchanged Secret is detected and forces re-registration.
+func hashAccount(account api.AcmeAccount, eab *acme.ExternalAccountBinding) [64]byte {
+	var eabKID string
+	var eabKey []byte
+	if eab != nil {
+		eabKID = eab.KID
+		eabKey = eab.Key
+	}
+
+	return sha512.Sum512([]byte(fmt.Sprintf("%v|%s|%x|%v", account.Contacts, eabKID, eabKey, account.Status.KeyFingerprint)))
+}
+
+func fingerprintKey(key crypto.Signer) string {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		// Can't happen for the key types we generate.
+		utilruntime.HandleError(fmt.Errorf("can't marshal public key for fingerprinting: %w", err))
+		return ""
+	}
+
+	sum := sha512.Sum512(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// rotateAccountKey generates a new account key of the given algorithm, rolls it over at
+// the CA via RFC 8555 §7.3.5, and persists it into the account credentials Secret,
+// keeping the previous key under `tls.key.previous` for one reconcile cycle so operators
+// can roll back if the CA rejects subsequent requests signed with the new key.
+func (ac *AccountController) rotateAccountKey(ctx context.Context, client *acme.Client, secret *corev1.Secret, algorithm api.PrivateKeyAlgorithm) (*corev1.Secret, error) {
+	newKey, keyBlock, err := helpers.GeneratePrivateKey(algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("can't generate new account key: %w", err)
+	}
+
+	rollCtx, rollCtxCancel := context.WithTimeout(ctx, 15*time.Second)
+	defer rollCtxCancel()
+	err = client.AccountKeyRoll(rollCtx, newKey)
+	if err != nil {
+		return nil, fmt.Errorf("can't roll account key at the CA: %w", err)
+	}
+
+	newSecret := secret.DeepCopy()
+	newSecret.Data[AccountPreviousPrivateKeyDataKey] = newSecret.Data[corev1.TLSPrivateKeyKey]
+	newSecret.Data[corev1.TLSPrivateKeyKey] = pem.EncodeToMemory(keyBlock)
+
+	newSecret, err = ac.kubeClient.CoreV1().Secrets(secret.Namespace).Update(newSecret)
+	if err != nil {
+		return nil, fmt.Errorf("can't persist rotated account key: %w", err)
+	}
+
+	client.Key = newKey
+
+	return newSecret, nil
 }
@@ -0,0 +1,47 @@
+package acme
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+func TestHashAccountBindsResolvedEABKeyMaterial(t *testing.T) {
+	account := api.AcmeAccount{
+		Contacts: []string{"mailto:ops@example.com"},
+		Status: api.AcmeAccountStatus{
+			KeyFingerprint: "fingerprint-a",
+		},
+	}
+
+	eab := &acme.ExternalAccountBinding{KID: "kid-1", Key: []byte("key-material-a")}
+
+	base := hashAccount(account, eab)
+
+	if got := hashAccount(account, eab); got != base {
+		t.Errorf("hashAccount isn't stable across calls for the same input")
+	}
+
+	if got := hashAccount(account, nil); got == base {
+		t.Errorf("hashAccount didn't change when the EAB was removed")
+	}
+
+	rotatedKey := &acme.ExternalAccountBinding{KID: "kid-1", Key: []byte("key-material-b")}
+	if got := hashAccount(account, rotatedKey); got == base {
+		t.Errorf("hashAccount didn't change when the resolved EAB key material was rotated, even though the KID stayed the same")
+	}
+
+	differentContact := account
+	differentContact.Contacts = []string{"mailto:other@example.com"}
+	if got := hashAccount(differentContact, eab); got == base {
+		t.Errorf("hashAccount didn't change when the account contacts changed")
+	}
+
+	differentFingerprint := account
+	differentFingerprint.Status.KeyFingerprint = "fingerprint-b"
+	if got := hashAccount(differentFingerprint, eab); got == base {
+		t.Errorf("hashAccount didn't change when the account key fingerprint changed")
+	}
+}
@@ -1,26 +1,32 @@
 package route
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
 	cryptorand "crypto/rand"
-	"crypto/rsa"
 	"crypto/sha512"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math/rand"
+	"net"
 	"net/http"
 	"reflect"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/hkdf"
 	"k8s.io/client-go/util/retry"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -38,9 +44,11 @@ import (
 	_ "github.com/openshift/client-go/route/clientset/versioned/scheme"
 	acmeclient "github.com/tnozicka/openshift-acme/pkg/acme/client"
 	acmeclientbuilder "github.com/tnozicka/openshift-acme/pkg/acme/client/builder"
+	dnschallenge "github.com/tnozicka/openshift-acme/pkg/acme/challenge/dns"
 	"github.com/tnozicka/openshift-acme/pkg/api"
 	"github.com/tnozicka/openshift-acme/pkg/cert"
 	kubeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/kube"
+	"github.com/tnozicka/openshift-acme/pkg/metrics"
 	routeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/route"
 	routeutil "github.com/tnozicka/openshift-acme/pkg/route"
 	"github.com/tnozicka/openshift-acme/pkg/util"
@@ -54,17 +62,71 @@ const (
 	RenewalStandardDeviation = 1
 	RenewalMean              = 0
 	AcmeTimeout              = 60 * time.Second
+	dnsPropagationTimeout    = 2 * time.Minute
+
+	// RouteUpdateConflictRetries bounds how many times updateRouteTLSWithRetry re-fetches and reapplies
+	// a Route update after losing a resource-version race, before giving up and
+	// surfacing the conflict as a regular sync error.
+	RouteUpdateConflictRetries = 5
+
+	// DefaultRateLimiterBaseDelay, DefaultRateLimiterMaxDelay and
+	// DefaultRateLimiterMaxFastAttempts are default workqueue.NewItemFastSlowRateLimiter
+	// parameters for callers of NewRouteController; NewRouteController itself uses the
+	// values it is passed.
+	DefaultRateLimiterBaseDelay       = 1 * time.Second
+	DefaultRateLimiterMaxDelay        = 60 * time.Second
+	DefaultRateLimiterMaxFastAttempts = 5
+
+	// ConditionTypeReady is True when the Route's current certificate is valid and not
+	// due for renewal.
+	ConditionTypeReady = "Ready"
+	// ConditionTypeIssuing is True while an ACME order is in flight for the Route.
+	ConditionTypeIssuing = "Issuing"
+	// ConditionTypeRateLimited is True when the ACME CA last rejected a request with a
+	// rate limit error.
+	ConditionTypeRateLimited = "RateLimited"
+	// ConditionTypeChallengeFailed is True when the CA failed to validate the most
+	// recent authorization.
+	ConditionTypeChallengeFailed = "ChallengeFailed"
 )
 
 var (
 	KeyFunc = cache.DeletionHandlingMetaNamespaceKeyFunc
 	// controllerKind contains the schema.GroupVersionKind for this controller type.
 	controllerKind = routev1.SchemeGroupVersion.WithKind("Route")
+
+	// routeUpdateConflictBackoff bounds the re-fetch-and-retry loop updateRouteTLSWithRetry
+	// runs against a Route Update conflict, the same pattern OpenShift's DeploymentConfig
+	// change controller uses.
+	routeUpdateConflictBackoff = wait.Backoff{
+		Steps:    RouteUpdateConflictRetries,
+		Duration: 10 * time.Millisecond,
+		Factor:   1.0,
+	}
 )
 
+// secretsByOwnerUIDIndex indexes Secrets by the UID of their controlling owner, so
+// syncSecret can discover Secrets a Route used to own without listing the whole
+// namespace.
+const secretsByOwnerUIDIndex = "byOwnerUID"
+
+func secretOwnerUIDIndexFunc(obj interface{}) ([]string, error) {
+	secret := obj.(*corev1.Secret)
+
+	controllerRef := metav1.GetControllerOf(secret)
+	if controllerRef == nil || controllerRef.Kind != controllerKind.Kind {
+		return nil, nil
+	}
+
+	return []string{string(controllerRef.UID)}, nil
+}
+
 type RouteController struct {
-	acmeClientFactory *acmeclientbuilder.SharedClientFactory
-	orderTimeout      time.Duration
+	acmeClientFactory          *acmeclientbuilder.SharedClientFactory
+	orderTimeout               time.Duration
+	dnsProvider                dnschallenge.Provider
+	defaultPrivateKeyAlgorithm cert.PrivateKeyAlgorithm
+	defaultPrivateKeySize      string
 
 	kubeClient                 kubernetes.Interface
 	kubeInformersForNamespaces kubeinformers.Interface
@@ -82,6 +144,12 @@ type RouteController struct {
 func NewRouteController(
 	acmeClientFactory *acmeclientbuilder.SharedClientFactory,
 	orderTimeout time.Duration,
+	dnsProvider dnschallenge.Provider,
+	defaultPrivateKeyAlgorithm cert.PrivateKeyAlgorithm,
+	defaultPrivateKeySize string,
+	rateLimiterBaseDelay time.Duration,
+	rateLimiterMaxDelay time.Duration,
+	rateLimiterMaxFastAttempts int,
 	kubeClient kubernetes.Interface,
 	kubeInformersForNamespaces kubeinformers.Interface,
 	routeClient routeclientset.Interface,
@@ -92,7 +160,11 @@ func NewRouteController(
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
 
 	rc := &RouteController{
-		acmeClientFactory: acmeClientFactory,
+		acmeClientFactory:          acmeClientFactory,
+		orderTimeout:               orderTimeout,
+		dnsProvider:                dnsProvider,
+		defaultPrivateKeyAlgorithm: defaultPrivateKeyAlgorithm,
+		defaultPrivateKeySize:      defaultPrivateKeySize,
 
 		kubeClient:                 kubeClient,
 		kubeInformersForNamespaces: kubeInformersForNamespaces,
@@ -102,7 +174,7 @@ func NewRouteController(
 
 		recorder: eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: ControllerName}),
 
-		queue: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		queue: workqueue.NewRateLimitingQueue(workqueue.NewItemFastSlowRateLimiter(rateLimiterBaseDelay, rateLimiterMaxDelay, rateLimiterMaxFastAttempts)),
 	}
 
 	for _, namespace := range routeInformersForNamespaces.Namespaces() {
@@ -120,9 +192,13 @@ func NewRouteController(
 		informers := kubeInformersForNamespaces.InformersFor(namespace)
 
 		informers.Core().V1().Secrets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    rc.addSecret,
 			UpdateFunc: rc.updateSecret,
 			DeleteFunc: rc.deleteSecret,
 		})
+		informers.Core().V1().Secrets().Informer().AddIndexers(cache.Indexers{
+			secretsByOwnerUIDIndex: secretOwnerUIDIndexFunc,
+		})
 		rc.cachesToSync = append(rc.cachesToSync, informers.Core().V1().Secrets().Informer().HasSynced)
 	}
 
@@ -190,6 +266,23 @@ func (rc *RouteController) deleteRoute(obj interface{}) {
 	rc.enqueueRoute(route)
 }
 
+func (rc *RouteController) addSecret(obj interface{}) {
+	secret := obj.(*corev1.Secret)
+
+	controllerRef := metav1.GetControllerOf(secret)
+	if controllerRef == nil {
+		return
+	}
+
+	route := rc.resolveControllerRef(secret.Namespace, controllerRef)
+	if route == nil {
+		return
+	}
+
+	klog.V(4).Infof("Acme Secret %s/%s added.", secret.Namespace, secret.Name)
+	rc.enqueueRoute(route)
+}
+
 func (rc *RouteController) updateSecret(old, cur interface{}) {
 	oldSecret := old.(*corev1.Secret)
 	curSecret := cur.(*corev1.Secret)
@@ -207,6 +300,15 @@ func (rc *RouteController) updateSecret(old, cur interface{}) {
 		if route == nil {
 			return
 		}
+
+		// Updates that leave the certificate and key untouched (metadata, labels, ...)
+		// would otherwise requeue the Route for nothing. Only act on a change of the
+		// tls.crt or tls.key data we manage.
+		if bytes.Equal(oldSecret.Data[corev1.TLSCertKey], curSecret.Data[corev1.TLSCertKey]) &&
+			bytes.Equal(oldSecret.Data[corev1.TLSPrivateKeyKey], curSecret.Data[corev1.TLSPrivateKeyKey]) {
+			return
+		}
+
 		klog.V(4).Infof("Acme Secret %s/%s updated.", curSecret.Namespace, curSecret.Name)
 		rc.enqueueRoute(route)
 		return
@@ -261,6 +363,23 @@ func (rc *RouteController) resolveControllerRef(namespace string, controllerRef
 	return route
 }
 
+// domains returns the full set of DNS names the Route's certificate has to cover: the
+// Route's host plus any additional names requested via the
+// acme.openshift.io/subject-alternative-names annotation.
+func domains(route *routev1.Route) []string {
+	domains := []string{route.Spec.Host}
+
+	sans := route.Annotations[api.SubjectAlternativeNamesAnnotation]
+	for _, san := range strings.Split(sans, ",") {
+		san = strings.TrimSpace(san)
+		if len(san) != 0 {
+			domains = append(domains, san)
+		}
+	}
+
+	return domains
+}
+
 func needsCertKey(t time.Time, route *routev1.Route) (string, error) {
 	if route.Spec.TLS == nil || route.Spec.TLS.Key == "" || route.Spec.TLS.Certificate == "" {
 		return "Route is missing CertKey", nil
@@ -275,9 +394,11 @@ func needsCertKey(t time.Time, route *routev1.Route) (string, error) {
 		return "", fmt.Errorf("can't decode certificate from Route %s/%s: %v", route.Namespace, route.Name, err)
 	}
 
-	err = certificate.VerifyHostname(route.Spec.Host)
-	if err != nil {
-		return "", fmt.Errorf("route %s/%s: existing certificate doesn't match hostname %q", route.Namespace, route.Name, route.Spec.Host)
+	for _, domain := range domains(route) {
+		err = certificate.VerifyHostname(domain)
+		if err != nil {
+			return "", fmt.Errorf("route %s/%s: existing certificate doesn't match hostname %q", route.Namespace, route.Name, domain)
+		}
 	}
 
 	if !cert.IsValid(certificate, t) {
@@ -310,29 +431,90 @@ func needsCertKey(t time.Time, route *routev1.Route) (string, error) {
 	return "", nil
 }
 
-func (rc *RouteController) getStatus(routeReadOnly *routev1.Route) (*api.Status, error) {
-	status := &api.Status{}
-	if routeReadOnly.Annotations != nil {
-		statusString := routeReadOnly.Annotations[api.AcmeStatusAnnotation]
-		err := json.Unmarshal([]byte(statusString), status)
-		if err != nil {
-			return nil, fmt.Errorf("can't decode status annotation: %v", err)
-		}
+// statusHMACKey derives the account thumbprint and the HMAC key used to sign the status
+// annotation from the ACME account key, via HKDF-SHA512. Binding the MAC key to the
+// account means rotating the account (or pointing a CertIssuer at a different one)
+// invalidates any status signed under the old account.
+func statusHMACKey(client *acmeclient.Client) (key []byte, thumbprint string, err error) {
+	thumbprint, err = acme.JWKThumbprint(client.Client.Key.Public())
+	if err != nil {
+		return nil, "", fmt.Errorf("can't compute account thumbprint: %w", err)
+	}
+
+	kdf := hkdf.New(sha512.New, []byte(thumbprint), nil, []byte("openshift-acme/status-hmac"))
+	key = make([]byte, sha512.Size)
+	_, err = io.ReadFull(kdf, key)
+	if err != nil {
+		return nil, "", fmt.Errorf("can't derive status MAC key: %w", err)
+	}
+
+	return key, thumbprint, nil
+}
+
+func (rc *RouteController) getStatus(routeReadOnly *routev1.Route, client *acmeclient.Client) (*api.Status, error) {
+	statusString := routeReadOnly.Annotations[api.AcmeStatusAnnotation]
+	if len(statusString) == 0 {
+		return &api.Status{}, nil
+	}
+
+	signedStatus := &api.SignedStatus{}
+	err := json.Unmarshal([]byte(statusString), signedStatus)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode status annotation: %v", err)
 	}
 
-	// TODO: verify it matches account hash
+	macKey, thumbprint, err := statusHMACKey(client)
+	if err != nil {
+		return nil, err
+	}
 
-	// TODO: verify status signature
+	// The annotation was written under a different ACME account (e.g. the directory was
+	// rotated, or the account key was replaced out of band) - discard it so we start a
+	// fresh order rather than replaying a stale one.
+	if signedStatus.AccountThumbprint != thumbprint {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeStatusAccountMismatch", "Stored ACME status was signed for a different account; starting fresh")
+		return &api.Status{}, nil
+	}
+
+	mac := hmac.New(sha512.New, macKey)
+	mac.Write(signedStatus.Status)
+	if !hmac.Equal(mac.Sum(nil), signedStatus.MAC) {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeStatusSignatureInvalid", "Stored ACME status failed signature verification; treating as absent")
+		return &api.Status{}, nil
+	}
+
+	status := &api.Status{}
+	err = json.Unmarshal(signedStatus.Status, status)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode status: %v", err)
+	}
 
 	return status, nil
 }
 
-func (rc *RouteController) setStatus(route *routev1.Route, status *api.Status) error {
+func (rc *RouteController) setStatus(route *routev1.Route, status *api.Status, client *acmeclient.Client) error {
 	status.ObservedGeneration = route.Generation
 
-	// TODO: sign the status
+	statusBytes, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("can't encode status: %v", err)
+	}
 
-	bytes, err := json.Marshal(status)
+	macKey, thumbprint, err := statusHMACKey(client)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha512.New, macKey)
+	mac.Write(statusBytes)
+
+	signedStatus := &api.SignedStatus{
+		Status:            statusBytes,
+		AccountThumbprint: thumbprint,
+		MAC:               mac.Sum(nil),
+	}
+
+	bytes, err := json.Marshal(signedStatus)
 	if err != nil {
 		return fmt.Errorf("can't encode status annotation: %v", err)
 	}
@@ -342,10 +524,62 @@ func (rc *RouteController) setStatus(route *routev1.Route, status *api.Status) e
 	return nil
 }
 
-func (rc *RouteController) updateStatus(route *routev1.Route, status *api.Status) error {
+// updateRouteTLSWithRetry writes the issued certificate and key into the Route's TLS
+// config, re-fetching and reapplying the change on a resource-version conflict instead
+// of letting it fall through to the generic sync-error retry budget.
+func (rc *RouteController) updateRouteTLSWithRetry(namespace, name string, crtPEM, keyPEM []byte) (*routev1.Route, error) {
+	var updated *routev1.Route
+
+	err := retry.RetryOnConflict(routeUpdateConflictBackoff, func() error {
+		route, err := rc.routeClient.RouteV1().Routes(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		route = route.DeepCopy()
+		if route.Spec.TLS == nil {
+			route.Spec.TLS = &routev1.TLSConfig{
+				// Defaults
+				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
+				Termination:                   routev1.TLSTerminationEdge,
+			}
+		}
+		route.Spec.TLS.Key = string(keyPEM)
+		route.Spec.TLS.Certificate = string(crtPEM)
+
+		updated, err = rc.routeClient.RouteV1().Routes(namespace).Update(route)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// setCondition sets or updates a condition on status, following the standard
+// metav1.Condition conventions so users can `oc wait --for=condition=<type>`.
+func setCondition(status *api.Status, conditionType string, conditionStatus metav1.ConditionStatus, reason, message string) {
+	apimeta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: status.ObservedGeneration,
+	})
+}
+
+// isRateLimited reports whether err is an ACME error caused by exceeding the CA's rate
+// limit.
+func isRateLimited(err error) bool {
+	acmeErr, ok := err.(*acme.Error)
+	return ok && acmeErr.StatusCode == http.StatusTooManyRequests
+}
+
+func (rc *RouteController) updateStatus(route *routev1.Route, status *api.Status, client *acmeclient.Client) error {
 	oldRoute := route.DeepCopy()
 
-	err := rc.setStatus(route, status)
+	err := rc.setStatus(route, status, client)
 	if err != nil {
 		return fmt.Errorf("can't set status: %v", err)
 	}
@@ -366,105 +600,137 @@ func (rc *RouteController) updateStatus(route *routev1.Route, status *api.Status
 // In case an error happened, it has to simply return the error.
 // The retry logic should not be part of the business logic.
 // This function is not meant to be invoked concurrently with the same key.
-func (rc *RouteController) handle(key string) error {
+// sync reconciles the Route identified by key. outcome classifies how the sync ended for
+// SyncDuration (and tells the caller whether it's safe to Forget the key's rate limiter
+// history), defaulting to "success" and being overridden either by a branch below that
+// knows it's not done yet, or by the deferred check of the returned err.
+func (rc *RouteController) sync(ctx context.Context, key string) (outcome string, err error) {
 	startTime := time.Now()
+	outcome = "success"
 	klog.V(4).Infof("Started syncing Route %q (%v)", key, startTime)
 	defer func() {
+		if err != nil {
+			if apierrors.IsConflict(err) {
+				outcome = "conflict"
+			} else {
+				outcome = "error"
+			}
+		}
+		metrics.SyncDuration.WithLabelValues(rc.Name(), outcome).Observe(time.Since(startTime).Seconds())
 		klog.V(4).Infof("Finished syncing Route %q (%v)", key, time.Since(startTime))
 	}()
 
 	namespace, _, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
 		runtime.HandleError(err)
-		return err
+		return outcome, err
 	}
 
 	objReadOnly, exists, err := rc.routeInformersForNamespaces.InformersFor(namespace).Route().V1().Routes().Informer().GetIndexer().GetByKey(key)
 	if err != nil {
 		klog.Errorf("Fetching object with key %s from store failed with %v", key, err)
-		return err
+		return outcome, err
 	}
 
 	if !exists {
 		klog.V(4).Infof("Route %s does not exist anymore\n", key)
-		return nil
+		return outcome, nil
 	}
 
 	routeReadOnly := objReadOnly.(*routev1.Route)
 
 	// Don't act on objects that are being deleted.
 	if routeReadOnly.DeletionTimestamp != nil {
-		return nil
+		return outcome, nil
 	}
 
 	// We have to check if Route is admitted to be sure it owns the domain!
 	if !routeutil.IsAdmitted(routeReadOnly) {
 		klog.V(4).Infof("Skipping Route %s because it's not admitted", key)
-		return nil
+		return outcome, nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), AcmeTimeout)
+	ctx, cancel := context.WithTimeout(ctx, AcmeTimeout)
 	defer cancel()
 
 	client, err := rc.acmeClientFactory.GetClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get ACME client: %v", err)
+		return outcome, fmt.Errorf("failed to get ACME client: %v", err)
 	}
 
-	status, err := rc.getStatus(routeReadOnly)
+	status, err := rc.getStatus(routeReadOnly, client)
 	if err != nil {
-		return fmt.Errorf("can't get status: %v", err)
+		return outcome, fmt.Errorf("can't get status: %v", err)
 	}
 
 	if status.ProvisioningStatus == nil {
 		reason, err := needsCertKey(time.Now(), routeReadOnly)
 		if err != nil {
-			return err
+			return outcome, err
 		}
 
 		if len(reason) == 0 {
 			// Not eligible for renewal
 			klog.V(4).Infof("Route %q doesn't need new cert: %v", key)
-			return rc.updateStatus(routeReadOnly.DeepCopy(), status)
+			setCondition(status, ConditionTypeReady, metav1.ConditionTrue, "CertificateValid", "Current certificate is valid and not due for renewal")
+			setCondition(status, ConditionTypeIssuing, metav1.ConditionFalse, "NotIssuing", "No certificate issuance in progress")
+			return outcome, rc.updateStatus(routeReadOnly.DeepCopy(), status, client)
 		}
 
 		klog.V(1).Infof("Route %q needs new cert: %v", key, reason)
 	}
 
-	domain := routeReadOnly.Spec.Host
+	routeDomains := domains(routeReadOnly)
+
+	for _, d := range routeDomains {
+		if strings.HasPrefix(d, "*.") && util.ChallengeType(routeReadOnly) != "dns-01" {
+			rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeFailedAuthorization", "Wildcard hostname %q requires the dns-01 challenge type (set annotation %q)", d, api.ChallengeTypeAnnotation)
+			return outcome, fmt.Errorf("route %q: wildcard hostname %q requires the dns-01 challenge type", key, d)
+		}
+	}
 
 	if status.ProvisioningStatus == nil || len(status.ProvisioningStatus.OrderUri) == 0 {
-		order, err := client.Client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+		order, err := client.Client.AuthorizeOrder(ctx, acme.DomainIDs(routeDomains...))
 		if err != nil {
-			return err
+			if isRateLimited(err) {
+				setCondition(status, ConditionTypeRateLimited, metav1.ConditionTrue, "TooManyRequests", err.Error())
+				rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeRateLimited", "ACME CA rate-limited order creation: %v", err)
+				return outcome, rc.updateStatus(routeReadOnly.DeepCopy(), status, client)
+			}
+			return outcome, err
 		}
-		klog.V(1).Infof("Created Order %q for Route %q", order.URI, key)
+		klog.V(1).Infof("Created Order %q for Route %q with %d domain(s)", order.URI, key, len(routeDomains))
 
 		// We need to store the order URI immediately to prevent loosing it on error.
 		// Updating the route will make it requeue.
 		status.ProvisioningStatus.StartedAt = time.Now()
 		status.ProvisioningStatus.OrderUri = order.URI
-		return rc.updateStatus(routeReadOnly.DeepCopy(), status)
+		setCondition(status, ConditionTypeRateLimited, metav1.ConditionFalse, "NotRateLimited", "")
+		setCondition(status, ConditionTypeIssuing, metav1.ConditionTrue, "OrderCreated", fmt.Sprintf("Created ACME order %q", order.URI))
+		return outcome, rc.updateStatus(routeReadOnly.DeepCopy(), status, client)
 	}
 
 	// Clear stuck provisioning
 	if time.Now().After(status.ProvisioningStatus.StartedAt.Add(rc.orderTimeout)) {
 		klog.Warning("Route %q: Clearing stuck order %q", key, status.ProvisioningStatus.OrderUri)
+		metrics.OrderDuration.Observe(time.Since(status.ProvisioningStatus.StartedAt).Seconds())
+		metrics.OrderTotal.WithLabelValues(string(metrics.OrderResultStuck)).Inc()
+		setCondition(status, ConditionTypeIssuing, metav1.ConditionFalse, "OrderStuck", fmt.Sprintf("Order %q did not complete within %s and was abandoned", status.ProvisioningStatus.OrderUri, rc.orderTimeout))
 		status.ProvisioningStatus = nil
-		return rc.updateStatus(routeReadOnly.DeepCopy(), status)
+		return outcome, rc.updateStatus(routeReadOnly.DeepCopy(), status, client)
 	}
 
 	order, err := client.Client.GetOrder(ctx, status.ProvisioningStatus.OrderUri)
 	if err != nil {
 		acmeErr, ok := err.(*acme.Error)
 		if !ok || acmeErr.StatusCode != http.StatusNotFound {
-			return err
+			return outcome, err
 		}
 
 		// The order URI doesn't exist. Delete OrderUri and update the status.
 		klog.Warning("Route %q: Found invalid OrderURI %q, removing it.", key, status.ProvisioningStatus.OrderUri)
 		status.ProvisioningStatus.OrderUri = ""
-		return rc.updateStatus(routeReadOnly.DeepCopy(), status)
+		return outcome, rc.updateStatus(routeReadOnly.DeepCopy(), status, client)
 	}
 
 	status.ProvisioningStatus.OrderStatus = order.Status
@@ -479,7 +745,7 @@ func (rc *RouteController) handle(key string) error {
 		for _, authzUrl := range order.AuthzURLs {
 			authz, err := client.Client.GetAuthorization(ctx, authzUrl)
 			if err != nil {
-				return err
+				return outcome, err
 			}
 
 			klog.V(4).Infof("Route %q: order %q: authz %q: is in %q state", key, order.URI, authz.URI, authz.Status)
@@ -492,27 +758,53 @@ func (rc *RouteController) handle(key string) error {
 				continue
 
 			default:
-				return fmt.Errorf("route %q: order %q: authz %q has invalid status %q", key, order.URI, authz.URI, authz.Status)
+				return outcome, fmt.Errorf("route %q: order %q: authz %q has invalid status %q", key, order.URI, authz.URI, authz.Status)
 			}
 
 			// Authz is Pending
 
+			// Resolve the challenge type per authorization rather than once for the
+			// whole Route, so a Route can mix a plain-host SAN on the configured
+			// default with a wildcard SAN that can only ever be solved via dns-01.
+			challengeType := util.ChallengeType(routeReadOnly)
+			if strings.HasPrefix(authz.Identifier.Value, "*.") {
+				challengeType = "dns-01"
+			}
+
 			var challenge *acme.Challenge
 			for _, c := range authz.Challenges {
-				if c.Type == "http-01" {
+				if c.Type == challengeType {
 					challenge = c
 				}
 			}
 
 			if challenge == nil {
-				// TODO: emit an event
-				return fmt.Errorf("route %q: unable to satisfy authorization %q for domain %q: no viable challenge type found in %v", key, authz.URI, domain, authz.Challenges)
+				metrics.ChallengeTotal.WithLabelValues(challengeType, string(metrics.ChallengeResultFailure)).Inc()
+				rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeFailedAuthorization", "No %q challenge offered for domain %q in %v", challengeType, authz.Identifier.Value, authz.Challenges)
+				return outcome, fmt.Errorf("route %q: unable to satisfy authorization %q for domain %q: no viable challenge type %q found in %v", key, authz.URI, authz.Identifier.Value, challengeType, authz.Challenges)
 			}
 
 			klog.V(4).Infof("route %q: order %q: authz %q: challenge %q is in %q state", key, order.URI, authz.URI, authz.Status, challenge.Status)
 
 			switch challenge.Status {
 			case acme.StatusPending:
+				if challengeType == "dns-01" {
+					err := rc.presentDNS01Challenge(ctx, client, challenge, authz.Identifier.Value)
+					if err != nil {
+						metrics.ChallengeTotal.WithLabelValues(challengeType, string(metrics.ChallengeResultFailure)).Inc()
+						return outcome, fmt.Errorf("route %q: can't present dns-01 challenge for %q: %w", key, authz.Identifier.Value, err)
+					}
+
+					_, err = client.Client.Accept(ctx, challenge)
+					if err != nil {
+						metrics.ChallengeTotal.WithLabelValues(challengeType, string(metrics.ChallengeResultFailure)).Inc()
+						return outcome, err
+					}
+
+					metrics.ChallengeTotal.WithLabelValues(challengeType, string(metrics.ChallengeResultSuccess)).Inc()
+					continue
+				}
+
 				tmpName := getTemporaryName(routeReadOnly.Name + ":" + order.URI + ":" + authzUrl + ":" + challenge.URI)
 
 				/*
@@ -563,10 +855,10 @@ func (rc *RouteController) handle(key string) error {
 							return nil
 						})
 						if err != nil {
-							return err
+							return outcome, err
 						}
 					} else {
-						return err
+						return outcome, err
 					}
 				}
 
@@ -628,10 +920,10 @@ func (rc *RouteController) handle(key string) error {
 							return nil
 						})
 						if err != nil {
-							return err
+							return outcome, err
 						}
 					} else {
-						return err
+						return outcome, err
 					}
 				}
 
@@ -673,10 +965,10 @@ func (rc *RouteController) handle(key string) error {
 							return nil
 						})
 						if err != nil {
-							return err
+							return outcome, err
 						}
 					} else {
-						return err
+						return outcome, err
 					}
 				}
 
@@ -687,9 +979,12 @@ func (rc *RouteController) handle(key string) error {
 
 				_, err = client.Client.Accept(ctx, challenge)
 				if err != nil {
-					return err
+					metrics.ChallengeTotal.WithLabelValues(challengeType, string(metrics.ChallengeResultFailure)).Inc()
+					return outcome, err
 				}
 
+				metrics.ChallengeTotal.WithLabelValues(challengeType, string(metrics.ChallengeResultSuccess)).Inc()
+
 			case acme.StatusProcessing, acme.StatusValid, acme.StatusInvalid:
 				// These states will manifest into global order state over time.
 				// We only need to attend to pending states.
@@ -697,11 +992,11 @@ func (rc *RouteController) handle(key string) error {
 				continue
 
 			default:
-				return fmt.Errorf("route %q: order %q: authz %q: invalid status %q for challenge %q", key, order.URI, authz.URI, challenge.Status, challenge.URI)
+				return outcome, fmt.Errorf("route %q: order %q: authz %q: invalid status %q for challenge %q", key, order.URI, authz.URI, challenge.Status, challenge.URI)
 			}
 		}
 
-		return rc.updateStatus(routeReadOnly.DeepCopy(), status)
+		return outcome, rc.updateStatus(routeReadOnly.DeepCopy(), status, client)
 
 	case acme.StatusValid:
 		// FIXME: should be separate step after acme.StatusReady - needs fixing golang acme lib
@@ -713,16 +1008,19 @@ func (rc *RouteController) handle(key string) error {
 				CommonName: routeReadOnly.Spec.Host,
 			},
 		}
-		template.DNSNames = append(template.DNSNames, routeReadOnly.Spec.Host)
+		template.DNSNames = append(template.DNSNames, domains(routeReadOnly)...)
 		klog.V(4).Infof("Route %q: Order %q: CSR template: %#v", template)
-		privateKey, err := rsa.GenerateKey(cryptorand.Reader, 4096)
+
+		keyAlgorithm, keySize := rc.privateKeyAlgorithmAndSize(routeReadOnly)
+		privateKey, err := cert.GeneratePrivateKey(keyAlgorithm, keySize)
 		if err != nil {
-			return fmt.Errorf("failed to generate RSA key: %v", err)
+			rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeFailedAuthorization", "Can't generate %s/%s private key: %v", keyAlgorithm, keySize, err)
+			return outcome, fmt.Errorf("failed to generate %s/%s private key: %v", keyAlgorithm, keySize, err)
 		}
 
 		csr, err := x509.CreateCertificateRequest(cryptorand.Reader, &template, privateKey)
 		if err != nil {
-			return fmt.Errorf("failed to create certificate request: %v", err)
+			return outcome, fmt.Errorf("failed to create certificate request: %v", err)
 		}
 		klog.V(4).Infof("Route %q: Order %q: CSR: %#v", key, order.URI, string(csr))
 
@@ -731,58 +1029,198 @@ func (rc *RouteController) handle(key string) error {
 		//  although that should be asynchronous. Requires fixing golang lib. (The helpers used are private.)
 		der, certUrl, err := client.Client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
 		if err != nil {
-			return err
+			return outcome, err
 		}
 
 		klog.V(4).Infof("Route %q: Order %q: Certificate available at %q", key, order.URI, certUrl)
 
 		certPemData, err := cert.NewCertificateFromDER(der, privateKey)
 		if err != nil {
-			return fmt.Errorf("can't convert certificate from DER to PEM: %v", err)
+			return outcome, fmt.Errorf("can't convert certificate from DER to PEM: %v", err)
 		}
 
-		route := routeReadOnly.DeepCopy()
-		if route.Spec.TLS == nil {
-			route.Spec.TLS = &routev1.TLSConfig{
-				// Defaults
-				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
-				Termination:                   routev1.TLSTerminationEdge,
-			}
+		_, err = rc.updateRouteTLSWithRetry(routeReadOnly.Namespace, routeReadOnly.Name, certPemData.Crt, certPemData.Key)
+		if err != nil {
+			return outcome, fmt.Errorf("can't update route %s/%s with new certificates: %v", routeReadOnly.Namespace, routeReadOnly.Name, err)
 		}
-		route.Spec.TLS.Key = string(certPemData.Key)
-		route.Spec.TLS.Certificate = string(certPemData.Crt)
 
-		_, err = rc.routeClient.RouteV1().Routes(routeReadOnly.Namespace).Update(route)
-		if err != nil {
-			return fmt.Errorf("can't update route %s/%s with new certificates: %v", routeReadOnly.Namespace, route.Name, err)
+		metrics.CertificatesProvisionedTotal.WithLabelValues(rc.Name()).Inc()
+
+		if len(der) > 0 {
+			if leaf, err := x509.ParseCertificate(der[0]); err == nil {
+				metrics.CertificateExpirationTimestamp.WithLabelValues(routeReadOnly.Namespace, routeReadOnly.Name).Set(float64(leaf.NotAfter.Unix()))
+			} else {
+				klog.Warningf("Route %q: can't parse issued certificate to record expiration metric: %v", key, err)
+			}
 		}
 
+		metrics.OrderDuration.Observe(time.Since(status.ProvisioningStatus.StartedAt).Seconds())
+		metrics.OrderTotal.WithLabelValues(string(metrics.OrderResultSuccess)).Inc()
+
+		setCondition(status, ConditionTypeReady, metav1.ConditionTrue, "CertificateIssued", "Certificate was issued successfully")
+		setCondition(status, ConditionTypeIssuing, metav1.ConditionFalse, "NotIssuing", "No certificate issuance in progress")
+		setCondition(status, ConditionTypeChallengeFailed, metav1.ConditionFalse, "NotFailed", "")
+
 		status.ProvisioningStatus = nil
 
-		return rc.updateStatus(routeReadOnly.DeepCopy(), status)
+		return outcome, rc.updateStatus(routeReadOnly.DeepCopy(), status, client)
 
 	case acme.StatusProcessing:
-		// TODO: backoff but capped at some reasonable time
-		rc.queue.AddAfter(routeReadOnly, 15*time.Second)
+		// Back off with the fast/slow rate limiter instead of a fixed delay: polling a
+		// pending order too aggressively wastes ACME rate budget on CAs that are slow
+		// to validate.
+		rc.queue.AddRateLimited(key)
+		outcome = "acme_processing"
 
 		klog.V(4).Infof("Route %q: Order %q: Waiting to be validated by ACME server")
 
-		return rc.updateStatus(routeReadOnly.DeepCopy(), status)
+		return outcome, rc.updateStatus(routeReadOnly.DeepCopy(), status, client)
 
 	case acme.StatusInvalid:
 		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeFailedAuthorization", "Acme provider failed to validate domain %q: %s", routeReadOnly.Spec.Host, acmeclient.GetAuthorizationErrors(authorization))
 
-		return rc.updateStatus(routeReadOnly.DeepCopy(), status)
+		metrics.OrderTotal.WithLabelValues(string(metrics.OrderResultFailure)).Inc()
+		setCondition(status, ConditionTypeChallengeFailed, metav1.ConditionTrue, "AuthorizationFailed", acmeclient.GetAuthorizationErrors(authorization))
+		outcome = "acme_invalid"
+
+		return outcome, rc.updateStatus(routeReadOnly.DeepCopy(), status, client)
 
 	default:
-		return fmt.Errorf("route %q: invalid new order status %q; order URL: %q", key, order.Status, order.URI)
+		return outcome, fmt.Errorf("route %q: invalid new order status %q; order URL: %q", key, order.Status, order.URI)
 	}
 }
 
-func (rc *RouteController) syncSecret(routeReadOnly *routev1.Route) error {
-	// TODO: consider option of choosing a oldSecret name using an annotation
-	secretName := routeReadOnly.Name
+// presentDNS01Challenge publishes the TXT record required by a dns-01 challenge via the
+// configured Provider and polls DNS through the system resolver until the record is
+// visible (or dnsPropagationTimeout is reached). The caller tells the ACME server to
+// validate the challenge once this returns without error.
+func (rc *RouteController) presentDNS01Challenge(ctx context.Context, client *acmeclient.Client, challenge *acme.Challenge, domain string) error {
+	if rc.dnsProvider == nil {
+		return fmt.Errorf("no DNS-01 provider configured")
+	}
+
+	fqdn := "_acme-challenge." + strings.TrimPrefix(domain, "*.") + "."
+	value := client.Client.DNS01ChallengeRecord(challenge.Token)
+
+	err := rc.dnsProvider.Present(domain, fqdn, value)
+	if err != nil {
+		return fmt.Errorf("can't present dns-01 challenge record %q: %w", fqdn, err)
+	}
+
+	err = wait.PollImmediate(5*time.Second, dnsPropagationTimeout, func() (bool, error) {
+		values, err := net.LookupTXT(strings.TrimSuffix(fqdn, "."))
+		if err != nil {
+			klog.V(4).Infof("dns-01: %q not resolvable yet: %v", fqdn, err)
+			return false, nil
+		}
+
+		for _, v := range values {
+			if v == value {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("TXT record %q did not propagate within %s: %w", fqdn, dnsPropagationTimeout, err)
+	}
 
+	return nil
+}
+
+// privateKeyAlgorithmAndSize resolves the certificate private key algorithm and size a
+// Route should use, preferring its acme.openshift.io/private-key-algorithm and
+// acme.openshift.io/private-key-size annotations and falling back to the operator's
+// configured defaults.
+func (rc *RouteController) privateKeyAlgorithmAndSize(route *routev1.Route) (cert.PrivateKeyAlgorithm, string) {
+	algorithm := cert.PrivateKeyAlgorithm(route.Annotations[api.PrivateKeyAlgorithmAnnotation])
+	if len(algorithm) == 0 {
+		algorithm = rc.defaultPrivateKeyAlgorithm
+	}
+
+	size := route.Annotations[api.PrivateKeySizeAnnotation]
+	if len(size) == 0 {
+		size = rc.defaultPrivateKeySize
+	}
+
+	return algorithm, size
+}
+
+// secretNames returns the set of Secret names the Route's certificate should be
+// mirrored into: the comma-separated acme.openshift.io/secret-names annotation if set,
+// else the single acme.openshift.io/secret-name annotation, else the Route's own name.
+func secretNames(route *routev1.Route) []string {
+	if raw := route.Annotations[api.SecretNamesAnnotation]; len(raw) != 0 {
+		var names []string
+		for _, n := range strings.Split(raw, ",") {
+			n = strings.TrimSpace(n)
+			if len(n) != 0 {
+				names = append(names, n)
+			}
+		}
+		if len(names) != 0 {
+			return names
+		}
+	}
+
+	if name := route.Annotations[api.SecretNameAnnotation]; len(name) != 0 {
+		return []string{name}
+	}
+
+	return []string{route.Name}
+}
+
+// syncSecret reconciles every Secret the Route's annotations (or, by default, its own
+// name) ask the certificate to be mirrored into, and removes any Secret this Route
+// previously owned that has fallen out of the desired set.
+func (rc *RouteController) syncSecret(ctx context.Context, routeReadOnly *routev1.Route) error {
+	desiredNames := secretNames(routeReadOnly)
+	desired := make(map[string]bool, len(desiredNames))
+	for _, name := range desiredNames {
+		desired[name] = true
+	}
+
+	for _, name := range desiredNames {
+		err := rc.syncOneSecret(routeReadOnly, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	ownedObjs, err := rc.kubeInformersForNamespaces.InformersFor(routeReadOnly.Namespace).Core().V1().Secrets().Informer().GetIndexer().ByIndex(secretsByOwnerUIDIndex, string(routeReadOnly.UID))
+	if err != nil {
+		return fmt.Errorf("can't list Secrets owned by Route %s/%s: %v", routeReadOnly.Namespace, routeReadOnly.Name, err)
+	}
+
+	for _, obj := range ownedObjs {
+		secret := obj.(*corev1.Secret)
+		if desired[secret.Name] {
+			continue
+		}
+
+		var gracePeriod int64 = 0
+		propagationPolicy := metav1.DeletePropagationBackground
+		preconditions := metav1.Preconditions{
+			UID: &secret.UID,
+		}
+		err := rc.kubeClient.CoreV1().Secrets(routeReadOnly.Namespace).Delete(secret.Name, &metav1.DeleteOptions{
+			GracePeriodSeconds: &gracePeriod,
+			PropagationPolicy:  &propagationPolicy,
+			Preconditions:      &preconditions,
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete stale Secret %s/%s: %s", routeReadOnly.Namespace, secret.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// syncOneSecret reconciles a single target Secret name. Conflicts with a Secret owned
+// by someone else are reported as a CollidingSecret event and otherwise ignored so the
+// rest of the Route's target Secrets still get reconciled.
+func (rc *RouteController) syncOneSecret(routeReadOnly *routev1.Route, secretName string) error {
 	secretExists := true
 	oldSecret, err := rc.kubeInformersForNamespaces.InformersFor(routeReadOnly.Namespace).Core().V1().Secrets().Lister().Secrets(routeReadOnly.Namespace).Get(secretName)
 	if err != nil {
@@ -794,7 +1232,7 @@ func (rc *RouteController) syncSecret(routeReadOnly *routev1.Route) error {
 
 	// We need to make sure we can modify this oldSecret (has our controllerRef)
 	if secretExists {
-		controllerRef := GetControllerRef(&oldSecret.ObjectMeta)
+		controllerRef := metav1.GetControllerOf(oldSecret)
 		if controllerRef == nil || controllerRef.UID != routeReadOnly.UID {
 			rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "CollidingSecret", "Can't sync certificates for Route %s/%s into Secret %s/%s because it already exists and isn't owned by the Route!", routeReadOnly.Namespace, routeReadOnly.Name, routeReadOnly.Namespace, secretName)
 			return nil
@@ -876,8 +1314,16 @@ func (rc *RouteController) syncSecret(routeReadOnly *routev1.Route) error {
 }
 
 // handleErr checks if an error happened and makes sure we will retry later.
-func (rc *RouteController) handleErr(err error, key interface{}) {
+func (rc *RouteController) handleErr(outcome string, err error, key interface{}) {
 	if err == nil {
+		if outcome == "acme_processing" {
+			// The order is still being validated by the ACME server and sync already
+			// re-enqueued the key with AddRateLimited. Forgetting here would wipe that
+			// attempt count on every poll, so the limiter could never back off past its
+			// fast tier.
+			return
+		}
+
 		// Forget about the #AddRateLimited history of the key on every successful synchronization.
 		// This ensures that future processing of updates for this key is not delayed because of
 		// an outdated error history.
@@ -900,7 +1346,9 @@ func (rc *RouteController) handleErr(err error, key interface{}) {
 	klog.Infof("Dropping Route %q out of the queue: %v", key, err)
 }
 
-func (rc *RouteController) processNextItem() bool {
+func (rc *RouteController) processNextItem(ctx context.Context) bool {
+	metrics.WorkqueueDepth.WithLabelValues(rc.Name()).Set(float64(rc.queue.Len()))
+
 	// Wait until there is a new item in the working queue
 	key, quit := rc.queue.Get()
 	if quit {
@@ -912,18 +1360,26 @@ func (rc *RouteController) processNextItem() bool {
 	defer rc.queue.Done(key)
 
 	// Invoke the method containing the business logic
-	err := rc.handle(key.(string))
+	outcome, err := rc.sync(ctx, key.(string))
 	// Handle the error if something went wrong during the execution of the business logic
-	rc.handleErr(err, key)
+	rc.handleErr(outcome, err, key)
 	return true
 }
 
-func (rc *RouteController) runWorker() {
-	for rc.processNextItem() {
+func (rc *RouteController) runWorker(ctx context.Context) {
+	for rc.processNextItem(ctx) {
 	}
 }
 
-func (rc *RouteController) Run(workers int, stopCh <-chan struct{}) {
+// Name identifies this controller as the "controller" label on its Prometheus metrics.
+func (rc *RouteController) Name() string {
+	return "route-acme-controller"
+}
+
+// Run starts the controller's workers and blocks until ctx is done. Driving shutdown off
+// a context, rather than a stopCh, lets the controller be run under a leader-elected
+// manager.Manager alongside controllers that expect the same lifecycle interface.
+func (rc *RouteController) Run(ctx context.Context, workers int) {
 	defer runtime.HandleCrash()
 
 	// Let the workers stop when we are done
@@ -933,7 +1389,7 @@ func (rc *RouteController) Run(workers int, stopCh <-chan struct{}) {
 	defer klog.Info("Shutting down Route controller")
 
 	// Wait for all involved caches to be synced, before processing items from the queue is started
-	if !cache.WaitForCacheSync(stopCh, rc.cachesToSync...) {
+	if !cache.WaitForCacheSync(ctx.Done(), rc.cachesToSync...) {
 		runtime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
 		return
 	}
@@ -941,10 +1397,10 @@ func (rc *RouteController) Run(workers int, stopCh <-chan struct{}) {
 	klog.Info("Route controller informer caches synced")
 
 	for i := 0; i < workers; i++ {
-		go wait.Until(rc.runWorker, time.Second, stopCh)
+		go wait.UntilWithContext(ctx, rc.runWorker, time.Second)
 	}
 
-	<-stopCh
+	<-ctx.Done()
 }
 
 func getTemporaryName(key string) string {
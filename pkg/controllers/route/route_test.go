@@ -0,0 +1,169 @@
+package route
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"reflect"
+	"testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"golang.org/x/crypto/acme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	acmeclient "github.com/tnozicka/openshift-acme/pkg/acme/client"
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+func newTestAcmeClient(t *testing.T) *acmeclient.Client {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("can't generate account key: %v", err)
+	}
+
+	return &acmeclient.Client{Client: &acme.Client{Key: key}}
+}
+
+func TestDomains(t *testing.T) {
+	tt := []struct {
+		name     string
+		route    *routev1.Route
+		expected []string
+	}{
+		{
+			name: "no SAN annotation returns just the host",
+			route: &routev1.Route{
+				Spec: routev1.RouteSpec{Host: "example.com"},
+			},
+			expected: []string{"example.com"},
+		},
+		{
+			name: "SANs are appended in order",
+			route: &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						api.SubjectAlternativeNamesAnnotation: "foo.example.com,bar.example.com",
+					},
+				},
+				Spec: routev1.RouteSpec{Host: "example.com"},
+			},
+			expected: []string{"example.com", "foo.example.com", "bar.example.com"},
+		},
+		{
+			name: "whitespace around SANs is trimmed and empty entries are dropped",
+			route: &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						api.SubjectAlternativeNamesAnnotation: " foo.example.com ,, bar.example.com,",
+					},
+				},
+				Spec: routev1.RouteSpec{Host: "example.com"},
+			},
+			expected: []string{"example.com", "foo.example.com", "bar.example.com"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := domains(tc.route)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSecretNames(t *testing.T) {
+	tt := []struct {
+		name     string
+		route    *routev1.Route
+		expected []string
+	}{
+		{
+			name: "no annotations falls back to the Route name",
+			route: &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-route"},
+			},
+			expected: []string{"my-route"},
+		},
+		{
+			name: "single secret-name annotation wins over the Route name",
+			route: &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-route",
+					Annotations: map[string]string{
+						api.SecretNameAnnotation: "my-secret",
+					},
+				},
+			},
+			expected: []string{"my-secret"},
+		},
+		{
+			name: "secret-names annotation wins over secret-name and is split/trimmed",
+			route: &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-route",
+					Annotations: map[string]string{
+						api.SecretNameAnnotation:  "ignored",
+						api.SecretNamesAnnotation: " secret-a ,secret-b,,secret-c",
+					},
+				},
+			},
+			expected: []string{"secret-a", "secret-b", "secret-c"},
+		},
+		{
+			name: "secret-names annotation with only empty entries falls through",
+			route: &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-route",
+					Annotations: map[string]string{
+						api.SecretNamesAnnotation: " , ,",
+					},
+				},
+			},
+			expected: []string{"my-route"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := secretNames(tc.route)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestStatusHMACKeyIsStableAndAccountBound(t *testing.T) {
+	clientA := newTestAcmeClient(t)
+	clientB := newTestAcmeClient(t)
+
+	keyA1, thumbprintA1, err := statusHMACKey(clientA)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keyA2, thumbprintA2, err := statusHMACKey(clientA)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if thumbprintA1 != thumbprintA2 || !reflect.DeepEqual(keyA1, keyA2) {
+		t.Errorf("statusHMACKey isn't stable across calls for the same account")
+	}
+
+	keyB, thumbprintB, err := statusHMACKey(clientB)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if thumbprintA1 == thumbprintB {
+		t.Errorf("two distinct account keys produced the same thumbprint")
+	}
+	if reflect.DeepEqual(keyA1, keyB) {
+		t.Errorf("two distinct account keys produced the same status MAC key")
+	}
+}
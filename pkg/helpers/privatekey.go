@@ -0,0 +1,109 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+// GeneratePrivateKey generates a new private key for the given algorithm and returns
+// it together with the PEM block it should be persisted as.
+func GeneratePrivateKey(algorithm api.PrivateKeyAlgorithm) (crypto.Signer, *pem.Block, error) {
+	switch algorithm {
+	case "", api.PrivateKeyAlgorithmRSA4096:
+		key, err := rsa.GenerateKey(rand.Reader, 4096)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}, nil
+
+	case api.PrivateKeyAlgorithmRSA2048:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}, nil
+
+	case api.PrivateKeyAlgorithmECDSAP256:
+		return generateECDSAKey(elliptic.P256())
+
+	case api.PrivateKeyAlgorithmECDSAP384:
+		return generateECDSAKey(elliptic.P384())
+
+	case api.PrivateKeyAlgorithmEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported private key algorithm %q", algorithm)
+	}
+}
+
+func generateECDSAKey(curve elliptic.Curve) (crypto.Signer, *pem.Block, error) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+}
+
+// PrivateKeyFromSecret decodes the private key stored under the TLS private key data
+// key of a Secret, auto-detecting whether it is an RSA key (PKCS1), an EC key, or a
+// PKCS8-wrapped key (used for Ed25519 and, optionally, RSA/EC).
+func PrivateKeyFromSecret(secret *corev1.Secret) (crypto.Signer, error) {
+	keyBytes, ok := secret.Data[corev1.TLSPrivateKeyKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s is missing key %q", secret.Namespace, secret.Name, corev1.TLSPrivateKeyKey)
+	}
+
+	block, _ := pem.Decode(keyBytes)
+	if block == nil {
+		return nil, fmt.Errorf("secret %s/%s: failed to decode PEM block containing the private key", secret.Namespace, secret.Name)
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("secret %s/%s: decoded PKCS8 key of type %T doesn't implement crypto.Signer", secret.Namespace, secret.Name, key)
+		}
+		return signer, nil
+
+	default:
+		return nil, fmt.Errorf("secret %s/%s: unsupported PEM block type %q", secret.Namespace, secret.Name, block.Type)
+	}
+}
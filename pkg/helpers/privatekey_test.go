@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"encoding/pem"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+func TestGeneratePrivateKeyRoundTripsThroughSecret(t *testing.T) {
+	algorithms := []api.PrivateKeyAlgorithm{
+		"",
+		api.PrivateKeyAlgorithmRSA4096,
+		api.PrivateKeyAlgorithmRSA2048,
+		api.PrivateKeyAlgorithmECDSAP256,
+		api.PrivateKeyAlgorithmECDSAP384,
+		api.PrivateKeyAlgorithmEd25519,
+	}
+
+	for _, algorithm := range algorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			key, keyBlock, err := GeneratePrivateKey(algorithm)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			secret := &corev1.Secret{
+				Data: map[string][]byte{
+					corev1.TLSPrivateKeyKey: pem.EncodeToMemory(keyBlock),
+				},
+			}
+
+			roundTripped, err := PrivateKeyFromSecret(secret)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(key.Public(), roundTripped.Public()) {
+				t.Errorf("public key didn't round-trip through a Secret for algorithm %q", algorithm)
+			}
+		})
+	}
+}
+
+func TestGeneratePrivateKeyRejectsUnsupportedAlgorithm(t *testing.T) {
+	_, _, err := GeneratePrivateKey("not-a-real-algorithm")
+	if err == nil {
+		t.Errorf("expected an error for an unsupported algorithm, got nil")
+	}
+}
+
+func TestPrivateKeyFromSecretRejectsMissingDataKey(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-ns", Name: "my-secret"},
+		Data:       map[string][]byte{},
+	}
+
+	_, err := PrivateKeyFromSecret(secret)
+	if err == nil {
+		t.Errorf("expected an error for a Secret missing the TLS private key data key, got nil")
+	}
+}